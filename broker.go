@@ -1,79 +1,465 @@
 package broker
 
 import (
+	"runtime"
 	"sync"
 	"sync/atomic"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 )
 
+type patternSubscriber struct {
+	pattern *glob
+	sub     *subscriber
+}
+
+type querySubscriber struct {
+	query Query
+	sub   *subscriber
+}
+
+// shard holds the exact-match subscribers for the event types whose
+// fnv32 hash falls into it, each behind its own mutex so that Publish
+// calls for event types in different shards never contend; event types
+// that hash to the same shard still share its mutex.
+type shard struct {
+	mu          sync.RWMutex
+	subscribers map[string][]*subscriber
+}
+
 type Broker struct {
-	// event type -> subscribers map
-	subscribers map[string][]chan cloudevents.Event
+	// shards partition exact event-type subscriptions by fnv32(type) so
+	// Publish only takes the lock for the shard it needs.
+	shards []*shard
 
-	// all subscribers - these will receive all events
-	allSubscribers []chan cloudevents.Event
+	// allSubscribers, patternSubscribers and querySubscribers aren't
+	// keyed by a single event type, so they're kept as copy-on-write
+	// snapshots behind an atomic pointer: Publish reads them lock-free.
+	allSubscribers     atomic.Pointer[[]*subscriber]
+	patternSubscribers atomic.Pointer[[]patternSubscriber]
+	querySubscribers   atomic.Pointer[[]querySubscriber]
 
-	// mu protects subscribers
-	mu sync.RWMutex
-	// wg waits for all events to be processed
+	// wg waits for all in-flight Publish calls to finish delivering
 	wg sync.WaitGroup
 
 	// shuttingDown is set to true when the bus is being shut down
 	shuttingDown atomic.Bool
+	// shutdownCh is closed exactly once, by Shutdown, so a Block
+	// subscriber with no Context of its own still gets released instead
+	// of deadlocking Shutdown's wg.Wait() forever.
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+
+	// observerMu protects observers and serializes the synchronous,
+	// in-order observer pass at the start of every Publish
+	observerMu sync.Mutex
+	observers  []*observerFunc
+	// observerCount mirrors len(observers) so notifyObservers can skip
+	// taking observerMu on the common case of no observers at all,
+	// instead of serializing every Publish on one global mutex.
+	observerCount atomic.Int32
+}
+
+// observerFunc wraps a registered observer so Observe's cancel closure can
+// remove this exact registration by identity, even if the same function
+// value is registered more than once.
+type observerFunc struct {
+	fn func(cloudevents.Event) error
 }
 
 func NewBroker() *Broker {
-	return &Broker{
-		subscribers:  make(map[string][]chan cloudevents.Event),
-		shuttingDown: atomic.Bool{},
+	return NewBrokerWithShards(runtime.GOMAXPROCS(0))
+}
+
+// NewBrokerWithShards is NewBroker with an explicit exact-match shard
+// count, for callers that want to tune lock contention independently of
+// GOMAXPROCS.
+func NewBrokerWithShards(shardCount int) *Broker {
+	if shardCount < 1 {
+		shardCount = 1
+	}
+
+	shards := make([]*shard, shardCount)
+	for i := range shards {
+		shards[i] = &shard{subscribers: make(map[string][]*subscriber)}
+	}
+
+	return &Broker{shards: shards, shutdownCh: make(chan struct{})}
+}
+
+// fnv32a is an allocation-free inline FNV-1a. shardFor only uses the
+// result to pick a bucket, not to persist anything, so there's no need
+// to go through hash/fnv's hash.Hash32, which heap-allocates on every
+// call - a cost that would undermine the whole point of sharding on the
+// Publish/Subscribe hot path.
+func fnv32a(s string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= prime32
 	}
+	return h
+}
+
+func (eb *Broker) shardFor(eventType string) *shard {
+	return eb.shards[fnv32a(eventType)%uint32(len(eb.shards))]
 }
 
+// Subscribe subscribes to an exact event type, the literal "*" for every
+// event, or a glob-style pattern such as "order.*.created" or "audit.**".
+// It returns a 10-capacity buffered channel with the DropOldest overflow
+// policy, so a slow or undrained subscriber here can never block Publish -
+// unlike Block, which is a poor default for a caller with no handle on
+// the subscription to watch for ErrSlowConsumer or supply a Context. For
+// control over capacity and overflow behavior use SubscribeWithOptions.
 func (eb *Broker) Subscribe(eventType string) <-chan cloudevents.Event {
+	sub := eb.SubscribeWithOptions(eventType, SubscribeOptions{
+		Capacity:       10,
+		OverflowPolicy: DropOldest,
+	})
+	return sub.Events()
+}
+
+// SubscribeWithOptions subscribes to an exact event type, the literal "*"
+// for every event, or a glob-style pattern, with explicit control over the
+// channel capacity and slow-consumer behavior.
+func (eb *Broker) SubscribeWithOptions(eventType string, opts SubscribeOptions) Subscription {
+	sub := newSubscriber(opts)
+
+	if eb.shuttingDown.Load() {
+		sub.close(nil)
+		return sub
+	}
+
+	switch {
+	case eventType == "*": // Subscribe to all events
+		eb.addAllSubscriber(sub)
+		sub.unregister = func() { eb.removeAllSubscriber(sub) }
+
+	case isPattern(eventType): // Subscribe to a glob-style pattern
+		eb.addPatternSubscriber(patternSubscriber{pattern: compileGlob(eventType), sub: sub})
+		sub.unregister = func() { eb.removePatternSubscriber(sub) }
+
+	default:
+		s := eb.shardFor(eventType)
+		s.mu.Lock()
+		s.subscribers[eventType] = append(s.subscribers[eventType], sub)
+		s.mu.Unlock()
+		sub.unregister = func() { eb.removeExactSubscriber(eventType, sub) }
+	}
+
+	return sub
+}
+
+// SubscribeQuery subscribes to events matched by q, e.g. one built with
+// ParseQuery or the trivial implementations in the query subpackage. Like
+// Subscribe, it defaults to a 10-capacity buffer with the DropOldest
+// overflow policy so a slow subscriber here can't block Publish.
+func (eb *Broker) SubscribeQuery(q Query) Subscription {
+	sub := newSubscriber(SubscribeOptions{Capacity: 10, OverflowPolicy: DropOldest})
+
 	if eb.shuttingDown.Load() {
-		// Return a closed channel
-		ch := make(chan cloudevents.Event)
-		close(ch)
-		return ch
+		sub.close(nil)
+		return sub
+	}
+
+	eb.addQuerySubscriber(querySubscriber{query: q, sub: sub})
+	sub.unregister = func() { eb.removeQuerySubscriber(sub) }
+
+	return sub
+}
+
+func (eb *Broker) removeExactSubscriber(eventType string, sub *subscriber) {
+	s := eb.shardFor(eventType)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := s.subscribers[eventType]
+	for i, c := range subs {
+		if c == sub {
+			s.subscribers[eventType] = append(subs[:i], subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// addAllSubscriber, addPatternSubscriber and addQuerySubscriber append to
+// their copy-on-write snapshot via a compare-and-swap loop, so concurrent
+// writers never block a concurrent Publish reading the old snapshot.
+
+func (eb *Broker) addAllSubscriber(sub *subscriber) {
+	for {
+		old := eb.allSubscribers.Load()
+		next := append(append([]*subscriber(nil), derefAll(old)...), sub)
+		if eb.allSubscribers.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+func (eb *Broker) removeAllSubscriber(sub *subscriber) {
+	for {
+		old := eb.allSubscribers.Load()
+		oldSlice := derefAll(old)
+
+		idx := -1
+		for i, s := range oldSlice {
+			if s == sub {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+
+		next := make([]*subscriber, 0, len(oldSlice)-1)
+		next = append(next, oldSlice[:idx]...)
+		next = append(next, oldSlice[idx+1:]...)
+		if eb.allSubscribers.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+func (eb *Broker) addPatternSubscriber(ps patternSubscriber) {
+	for {
+		old := eb.patternSubscribers.Load()
+		next := append(append([]patternSubscriber(nil), derefPatterns(old)...), ps)
+		if eb.patternSubscribers.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+func (eb *Broker) removePatternSubscriber(sub *subscriber) {
+	for {
+		old := eb.patternSubscribers.Load()
+		oldSlice := derefPatterns(old)
+
+		idx := -1
+		for i, ps := range oldSlice {
+			if ps.sub == sub {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+
+		next := make([]patternSubscriber, 0, len(oldSlice)-1)
+		next = append(next, oldSlice[:idx]...)
+		next = append(next, oldSlice[idx+1:]...)
+		if eb.patternSubscribers.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+func (eb *Broker) addQuerySubscriber(qs querySubscriber) {
+	for {
+		old := eb.querySubscribers.Load()
+		next := append(append([]querySubscriber(nil), derefQueries(old)...), qs)
+		if eb.querySubscribers.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+func (eb *Broker) removeQuerySubscriber(sub *subscriber) {
+	for {
+		old := eb.querySubscribers.Load()
+		oldSlice := derefQueries(old)
+
+		idx := -1
+		for i, qs := range oldSlice {
+			if qs.sub == sub {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+
+		next := make([]querySubscriber, 0, len(oldSlice)-1)
+		next = append(next, oldSlice[:idx]...)
+		next = append(next, oldSlice[idx+1:]...)
+		if eb.querySubscribers.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+func derefAll(p *[]*subscriber) []*subscriber {
+	if p == nil {
+		return nil
 	}
+	return *p
+}
 
-	eb.mu.Lock()
-	defer eb.mu.Unlock()
-	ch := make(chan cloudevents.Event, 10) // Buffered channel
+func derefPatterns(p *[]patternSubscriber) []patternSubscriber {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
 
-	if eventType == "*" { // Subscribe to all events
-		eb.allSubscribers = append(eb.allSubscribers, ch)
-	} else {
-		eb.subscribers[eventType] = append(eb.subscribers[eventType], ch)
+func derefQueries(p *[]querySubscriber) []querySubscriber {
+	if p == nil {
+		return nil
 	}
+	return *p
+}
 
-	return ch
+// Observe registers fn to run synchronously, in publish order, at the
+// start of every Publish, before any subscriber fan-out - unlike
+// subscribers, which are buffered, concurrent and lossy under
+// backpressure, an observer is guaranteed in-order, at-least-once
+// delivery and back-pressures the publisher. If fn returns an error,
+// Publish returns it immediately and no subscriber receives that event.
+//
+// Observers must be fast: a slow observer blocks every call to Publish,
+// not just the one that's invoking it. Use this for indexing, audit
+// trails, tracing, or a WAL - not for arbitrary business logic.
+//
+// The returned cancel function deregisters fn; it is safe to call more
+// than once.
+func (eb *Broker) Observe(fn func(cloudevents.Event) error) (cancel func()) {
+	obs := &observerFunc{fn: fn}
+
+	eb.observerMu.Lock()
+	eb.observers = append(eb.observers, obs)
+	eb.observerMu.Unlock()
+	eb.observerCount.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			eb.observerMu.Lock()
+			defer eb.observerMu.Unlock()
+
+			for i, o := range eb.observers {
+				if o == obs {
+					eb.observers = append(eb.observers[:i], eb.observers[i+1:]...)
+					eb.observerCount.Add(-1)
+					return
+				}
+			}
+		})
+	}
 }
 
-func (eb *Broker) Publish(event cloudevents.Event) {
+// Publish fans event out to every matching subscriber. It returns an
+// error only if a registered observer rejects the event; subscriber
+// delivery errors are never returned since delivery is buffered, lossy
+// under backpressure, and has no single caller to report to.
+func (eb *Broker) Publish(event cloudevents.Event) error {
 	if eb.shuttingDown.Load() {
+		return nil
+	}
+
+	if err := eb.notifyObservers(event); err != nil {
+		return err
+	}
+
+	s := eb.shardFor(event.Type())
+	s.mu.RLock()
+	exact := append([]*subscriber(nil), s.subscribers[event.Type()]...)
+	s.mu.RUnlock()
+
+	all := derefAll(eb.allSubscribers.Load())
+	patterns := derefPatterns(eb.patternSubscribers.Load())
+	queries := derefQueries(eb.querySubscribers.Load())
+
+	eb.wg.Add(1)
+	defer eb.wg.Done()
+
+	for _, sub := range exact {
+		eb.deliver(sub, event)
+	}
+
+	for _, sub := range all {
+		eb.deliver(sub, event)
+	}
+
+	for _, ps := range patterns {
+		if ps.pattern.Match(event.Type()) {
+			eb.deliver(ps.sub, event)
+		}
+	}
+
+	for _, qs := range queries {
+		if qs.query.Matches(event) {
+			eb.deliver(qs.sub, event)
+		}
+	}
+
+	return nil
+}
+
+// notifyObservers runs every registered observer, in registration order,
+// under observerMu so concurrent publishers can't interleave their
+// observer passes. It returns the first error encountered, if any.
+func (eb *Broker) notifyObservers(event cloudevents.Event) error {
+	if eb.observerCount.Load() == 0 {
+		return nil
+	}
+
+	eb.observerMu.Lock()
+	defer eb.observerMu.Unlock()
+
+	for _, obs := range eb.observers {
+		if err := obs.fn(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver applies sub's OverflowPolicy to hand event to it without ever
+// spawning a goroutine: a single non-blocking send is attempted first, and
+// only a full buffer falls through to the configured policy. Every send
+// goes through subscriber's own locking so it can never race a concurrent
+// close (from Unsubscribe or a slow-consumer cancellation) on sub.events.
+func (eb *Broker) deliver(sub *subscriber, event cloudevents.Event) {
+	if sent, closed := sub.trySend(event); sent || closed {
 		return
 	}
 
-	eb.mu.RLock()
-	defer eb.mu.RUnlock()
+	switch sub.opts.OverflowPolicy {
+	case DropNewest:
+		// Keep the buffer as is, drop the incoming event.
+
+	case DropOldest:
+		sub.dropOldestOrDiscard(event)
 
-	for _, subs := range eb.subscribers[event.Type()] {
-		eb.wg.Add(1)
-		go func() {
-			defer eb.wg.Done()
-			subs <- event
-		}()
+	case Cancel:
+		eb.cancelSlowConsumer(sub)
+
+	default: // Block
+		var ctxDone <-chan struct{}
+		if sub.opts.Context != nil {
+			ctxDone = sub.opts.Context.Done()
+		}
+
+		if closed, cancel := sub.blockingSend(event, ctxDone, eb.shutdownCh); !closed && cancel {
+			eb.cancelSlowConsumer(sub)
+		}
 	}
+}
 
-	for _, subs := range eb.allSubscribers {
-		eb.wg.Add(1)
-		go func() {
-			defer eb.wg.Done()
-			subs <- event
-		}()
+func (eb *Broker) cancelSlowConsumer(sub *subscriber) {
+	if sub.unregister != nil {
+		sub.unregister()
 	}
+	sub.close(ErrSlowConsumer)
 }
 
 func (eb *Broker) SubscribeFunc(eventType string, f func(cloudevents.Event)) {
@@ -90,21 +476,36 @@ func (eb *Broker) Shutdown() {
 	// and new events from being published
 	eb.shuttingDown.Store(true)
 
-	// Wait for all events to be processed
-	eb.wg.Wait()
+	// Release any Block subscriber with no Context of its own that's
+	// currently parked in a blocking send, so it can't deadlock wg.Wait.
+	eb.shutdownOnce.Do(func() { close(eb.shutdownCh) })
 
-	eb.mu.Lock()
-	defer eb.mu.Unlock()
+	// Wait for all in-flight Publish calls to finish delivering
+	eb.wg.Wait()
 
-	// Close all typed subscriptions
-	for _, subs := range eb.subscribers {
-		for _, ch := range subs {
-			close(ch)
+	// Close every exact-match subscription, shard by shard
+	for _, s := range eb.shards {
+		s.mu.Lock()
+		for _, subs := range s.subscribers {
+			for _, sub := range subs {
+				sub.close(nil)
+			}
 		}
+		s.mu.Unlock()
 	}
 
 	// Close all wildcard subscriptions
-	for _, ch := range eb.allSubscribers {
-		close(ch)
+	for _, sub := range derefAll(eb.allSubscribers.Load()) {
+		sub.close(nil)
+	}
+
+	// Close all pattern subscriptions
+	for _, ps := range derefPatterns(eb.patternSubscribers.Load()) {
+		ps.sub.close(nil)
+	}
+
+	// Close all query subscriptions
+	for _, qs := range derefQueries(eb.querySubscribers.Load()) {
+		qs.sub.close(nil)
 	}
 }
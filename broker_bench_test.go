@@ -0,0 +1,42 @@
+package broker_test
+
+import (
+	"fmt"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/reverted/broker"
+)
+
+// BenchmarkPublishParallel measures how Publish scales with the number of
+// subscribers and the level of concurrency driving it, exercising the
+// per-shard locking added to avoid serializing every Publish on a single
+// broker-wide mutex.
+func BenchmarkPublishParallel(b *testing.B) {
+	for _, subscriberCount := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("subscribers=%d", subscriberCount), func(b *testing.B) {
+			bus := broker.NewBroker()
+			defer bus.Shutdown()
+
+			for i := 0; i < subscriberCount; i++ {
+				eventType := fmt.Sprintf("bench.event.%d", i)
+				bus.SubscribeFunc(eventType, func(cloudevents.Event) {})
+			}
+
+			events := make([]cloudevents.Event, subscriberCount)
+			for i := range events {
+				events[i] = createTestEvent(fmt.Sprintf("bench.event.%d", i), "data")
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					bus.Publish(events[i%len(events)])
+					i++
+				}
+			})
+		})
+	}
+}
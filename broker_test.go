@@ -1,6 +1,8 @@
 package broker_test
 
 import (
+	"errors"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -10,6 +12,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/reverted/broker"
+	"github.com/reverted/broker/query"
 )
 
 // Helper function to create a test event
@@ -257,3 +260,455 @@ func TestSubscribeToAllTypes(t *testing.T) {
 		t.Fatal("Timed out waiting for event")
 	}
 }
+
+// Test single-segment "*" wildcard matching within a pattern
+func TestSubscribeSingleSegmentWildcard(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	ch := b.Subscribe("order.*.created")
+
+	b.Publish(createTestEvent("order.widget.created", "match"))
+	b.Publish(createTestEvent("order.widget.updated", "no-match"))
+	b.Publish(createTestEvent("order.widget.extra.created", "no-match"))
+
+	select {
+	case receivedEvent := <-ch:
+		assert.Equal(t, "order.widget.created", receivedEvent.Type())
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for matching event")
+	}
+
+	select {
+	case receivedEvent := <-ch:
+		t.Fatalf("unexpected event received: %s", receivedEvent.Type())
+	case <-time.After(100 * time.Millisecond):
+		// expected - no further matches
+	}
+}
+
+// Test multi-segment "**" wildcard matching zero or more segments
+func TestSubscribeMultiSegmentWildcard(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	ch := b.Subscribe("audit.**")
+
+	b.Publish(createTestEvent("audit.login", "match"))
+	b.Publish(createTestEvent("audit.user.login.failed", "match"))
+	b.Publish(createTestEvent("billing.audit.login", "no-match"))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case receivedEvent := <-ch:
+			assert.Contains(t, receivedEvent.Type(), "audit")
+		case <-time.After(1 * time.Second):
+			t.Fatal("Timed out waiting for matching event")
+		}
+	}
+
+	select {
+	case receivedEvent := <-ch:
+		t.Fatalf("unexpected event received: %s", receivedEvent.Type())
+	case <-time.After(100 * time.Millisecond):
+		// expected - no further matches
+	}
+}
+
+// Test "?" single-character wildcard matching
+func TestSubscribeQuestionMarkWildcard(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	ch := b.Subscribe("job.step?.done")
+
+	b.Publish(createTestEvent("job.step1.done", "match"))
+	b.Publish(createTestEvent("job.step12.done", "no-match"))
+
+	select {
+	case receivedEvent := <-ch:
+		assert.Equal(t, "job.step1.done", receivedEvent.Type())
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for matching event")
+	}
+
+	select {
+	case receivedEvent := <-ch:
+		t.Fatalf("unexpected event received: %s", receivedEvent.Type())
+	case <-time.After(100 * time.Millisecond):
+		// expected - no further matches
+	}
+}
+
+// Test that an exact subscriber and an overlapping pattern subscriber both
+// receive a matching event - patterns don't preempt the exact fast path.
+func TestSubscribePatternAndExactPrecedence(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	exactCh := b.Subscribe("order.widget.created")
+	patternCh := b.Subscribe("order.*.created")
+
+	b.Publish(createTestEvent("order.widget.created", "test-data"))
+
+	select {
+	case receivedEvent := <-exactCh:
+		assert.Equal(t, "order.widget.created", receivedEvent.Type())
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for exact subscriber")
+	}
+
+	select {
+	case receivedEvent := <-patternCh:
+		assert.Equal(t, "order.widget.created", receivedEvent.Type())
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for pattern subscriber")
+	}
+}
+
+// Test that pattern subscriber channels are closed on shutdown
+func TestSubscribePatternShutdown(t *testing.T) {
+	b := broker.NewBroker()
+
+	ch := b.Subscribe("order.*.created")
+
+	b.Shutdown()
+
+	_, ok := <-ch
+	assert.False(t, ok, "pattern subscriber channel should be closed after shutdown")
+}
+
+// Test that DropNewest discards the published event once the buffer is full
+func TestSubscribeWithOptionsDropNewest(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	sub := b.SubscribeWithOptions("test.event", broker.SubscribeOptions{
+		Capacity:       1,
+		OverflowPolicy: broker.DropNewest,
+	})
+
+	b.Publish(createTestEvent("test.event", "first"))
+	b.Publish(createTestEvent("test.event", "second"))
+
+	var data string
+	received := <-sub.Events()
+	assert.NoError(t, received.DataAs(&data))
+	assert.Equal(t, "first", data)
+
+	select {
+	case <-sub.Events():
+		t.Fatal("DropNewest should have discarded the second event")
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+}
+
+// Test that DropOldest evicts the buffered event to make room for the new one
+func TestSubscribeWithOptionsDropOldest(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	sub := b.SubscribeWithOptions("test.event", broker.SubscribeOptions{
+		Capacity:       1,
+		OverflowPolicy: broker.DropOldest,
+	})
+
+	b.Publish(createTestEvent("test.event", "first"))
+	b.Publish(createTestEvent("test.event", "second"))
+
+	var data string
+	received := <-sub.Events()
+	assert.NoError(t, received.DataAs(&data))
+	assert.Equal(t, "second", data)
+}
+
+// Test that Cancel closes Events and reports ErrSlowConsumer once the
+// buffer is exhausted
+func TestSubscribeWithOptionsCancel(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	sub := b.SubscribeWithOptions("test.event", broker.SubscribeOptions{
+		Capacity:       1,
+		OverflowPolicy: broker.Cancel,
+	})
+
+	b.Publish(createTestEvent("test.event", "first"))
+	b.Publish(createTestEvent("test.event", "second"))
+
+	select {
+	case err := <-sub.Err():
+		assert.ErrorIs(t, err, broker.ErrSlowConsumer)
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for ErrSlowConsumer")
+	}
+
+	// Drain the one event that made it in, then Events should be closed.
+	<-sub.Events()
+	_, ok := <-sub.Events()
+	assert.False(t, ok, "Events should be closed after cancellation")
+}
+
+// Test that Unsubscribe removes the subscriber and closes Events without
+// reporting an error
+func TestSubscribeWithOptionsUnsubscribe(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	sub := b.SubscribeWithOptions("test.event", broker.SubscribeOptions{Capacity: 1})
+	sub.Unsubscribe()
+
+	_, ok := <-sub.Events()
+	assert.False(t, ok, "Events should be closed after Unsubscribe")
+
+	select {
+	case <-sub.Err():
+		t.Fatal("Unsubscribe should not report an error")
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+
+	// Publishing after Unsubscribe must not panic on the closed channel.
+	b.Publish(createTestEvent("test.event", "ignored"))
+}
+
+// Test that exact-match subscribers spread over many event types receive
+// their events and are all closed on shutdown, regardless of which shard
+// an event type happens to hash to
+func TestShardedExactSubscribersAllShutdown(t *testing.T) {
+	b := broker.NewBroker()
+
+	var chans []<-chan cloudevents.Event
+	for i := 0; i < 32; i++ {
+		chans = append(chans, b.Subscribe(fmt.Sprintf("event.type.%d", i)))
+	}
+
+	for i := range chans {
+		b.Publish(createTestEvent(fmt.Sprintf("event.type.%d", i), "data"))
+	}
+
+	for i, ch := range chans {
+		select {
+		case event := <-ch:
+			assert.Equal(t, fmt.Sprintf("event.type.%d", i), event.Type())
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Timed out waiting for event.type.%d", i)
+		}
+	}
+
+	b.Shutdown()
+
+	for i, ch := range chans {
+		_, ok := <-ch
+		assert.False(t, ok, "channel for event.type.%d should be closed after shutdown", i)
+	}
+}
+
+// Test that observers run synchronously, in registration order, before
+// any subscriber sees the event
+func TestObserveRunsInOrderBeforeSubscribers(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	var order []string
+	b.Observe(func(cloudevents.Event) error {
+		order = append(order, "first")
+		return nil
+	})
+	b.Observe(func(cloudevents.Event) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	ch := b.Subscribe("test.event")
+
+	err := b.Publish(createTestEvent("test.event", "data"))
+	assert.NoError(t, err)
+
+	select {
+	case <-ch:
+		order = append(order, "subscriber")
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for subscriber delivery")
+	}
+
+	assert.Equal(t, []string{"first", "second", "subscriber"}, order)
+}
+
+// Test that an observer error is returned by Publish and suppresses
+// subscriber delivery for that event
+func TestObserveErrorBlocksPublish(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	wantErr := errors.New("observer rejected event")
+	b.Observe(func(cloudevents.Event) error {
+		return wantErr
+	})
+
+	ch := b.Subscribe("test.event")
+
+	err := b.Publish(createTestEvent("test.event", "data"))
+	assert.ErrorIs(t, err, wantErr)
+
+	select {
+	case <-ch:
+		t.Fatal("subscriber should not receive an event an observer rejected")
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+}
+
+// Test that the cancel function returned by Observe deregisters it
+func TestObserveCancel(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	var calls int32
+	cancel := b.Observe(func(cloudevents.Event) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	assert.NoError(t, b.Publish(createTestEvent("test.event", "data")))
+	cancel()
+	cancel() // safe to call more than once
+	assert.NoError(t, b.Publish(createTestEvent("test.event", "data")))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+// Test that ParseQuery filters on type and source with AND/LIKE
+func TestSubscribeQueryTypeAndSourceLike(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	q, err := broker.ParseQuery(`type = 'order.created' AND source LIKE 'svc.%'`)
+	assert.NoError(t, err)
+
+	sub := b.SubscribeQuery(q)
+
+	matching := createTestEvent("order.created", "data")
+	matching.SetSource("svc.orders")
+	b.Publish(matching)
+
+	nonMatching := createTestEvent("order.created", "data")
+	nonMatching.SetSource("other.orders")
+	b.Publish(nonMatching)
+
+	select {
+	case received := <-sub.Events():
+		assert.Equal(t, "svc.orders", received.Source())
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for matching event")
+	}
+
+	select {
+	case received := <-sub.Events():
+		t.Fatalf("unexpected event received from %s", received.Source())
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+}
+
+// Test numeric comparison and AND over a dotted JSON data path
+func TestSubscribeQueryDataComparison(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	q, err := broker.ParseQuery(`type = 'order.created' AND data.amount > 100`)
+	assert.NoError(t, err)
+
+	sub := b.SubscribeQuery(q)
+
+	big := cloudevents.NewEvent()
+	big.SetID(uuid.New().String())
+	big.SetSource("test")
+	big.SetType("order.created")
+	assert.NoError(t, big.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"amount": 150}))
+	b.Publish(big)
+
+	small := cloudevents.NewEvent()
+	small.SetID(uuid.New().String())
+	small.SetSource("test")
+	small.SetType("order.created")
+	assert.NoError(t, small.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"amount": 10}))
+	b.Publish(small)
+
+	select {
+	case received := <-sub.Events():
+		var data struct {
+			Amount int `json:"amount"`
+		}
+		assert.NoError(t, received.DataAs(&data))
+		assert.Equal(t, 150, data.Amount)
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for matching event")
+	}
+
+	select {
+	case <-sub.Events():
+		t.Fatal("event below the data.amount threshold should not match")
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+}
+
+// Test IN (...) membership and extension attribute lookup
+func TestSubscribeQueryInAndExtension(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	q, err := broker.ParseQuery(`tenant IN ('acme', 'globex')`)
+	assert.NoError(t, err)
+
+	sub := b.SubscribeQuery(q)
+
+	match := createTestEvent("test.event", "data")
+	match.SetExtension("tenant", "acme")
+	b.Publish(match)
+
+	noMatch := createTestEvent("test.event", "data")
+	noMatch.SetExtension("tenant", "initech")
+	b.Publish(noMatch)
+
+	select {
+	case received := <-sub.Events():
+		assert.Equal(t, "acme", received.Extensions()["tenant"])
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for matching event")
+	}
+
+	select {
+	case <-sub.Events():
+		t.Fatal("tenant not in the IN (...) list should not match")
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+}
+
+// Test that query.All and query.Empty behave like "*" and no subscription
+func TestSubscribeQueryAllAndEmpty(t *testing.T) {
+	b := broker.NewBroker()
+	defer b.Shutdown()
+
+	all := b.SubscribeQuery(query.All{})
+	empty := b.SubscribeQuery(query.Empty{})
+
+	b.Publish(createTestEvent("test.event", "data"))
+
+	select {
+	case <-all.Events():
+		// expected
+	case <-time.After(1 * time.Second):
+		t.Fatal("query.All should match every event")
+	}
+
+	select {
+	case <-empty.Events():
+		t.Fatal("query.Empty should never match")
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	}
+}
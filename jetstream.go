@@ -0,0 +1,310 @@
+package broker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// ceContentType is set on the NATS message header to label the payload as
+// a structured-mode CloudEvent. Messages are encoded and decoded with the
+// CloudEvents JSON codec rather than the legacy gob/json EncodedConn
+// format NewNats relies on; decodeCloudEvent does not read the header.
+const ceContentType = "application/cloudevents+json"
+
+// DeliverPolicy controls where a JetStream consumer starts reading from
+// its stream.
+type DeliverPolicy int
+
+const (
+	// DeliverAll replays the whole retained history of the stream.
+	DeliverAll DeliverPolicy = iota
+	// DeliverLast delivers only the most recent message on the subject.
+	DeliverLast
+	// DeliverNew delivers only messages published after the consumer is
+	// created.
+	DeliverNew
+	// DeliverByStartTime delivers messages published at or after
+	// JetStreamOptions.DeliverStartTime.
+	DeliverByStartTime
+)
+
+// DurableCalculator names the durable consumer for a queue subscribed to
+// subject. The default is queue + "-" + hex(sha256(subject))[:12], so
+// multiple apps sharing a subject don't collide on consumer names.
+type DurableCalculator func(queue, subject string) string
+
+func defaultDurableCalculator(queue, subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return queue + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// JetStreamOptions configures a JetStreamAdapter.
+type JetStreamOptions struct {
+	// DurablePrefix, if set, is prepended to every durable consumer name.
+	DurablePrefix string
+	// DeliverPolicy controls where a new durable consumer starts reading
+	// from its stream. Defaults to DeliverAll.
+	DeliverPolicy DeliverPolicy
+	// DeliverStartTime is the cutoff used when DeliverPolicy is
+	// DeliverByStartTime; ignored otherwise.
+	DeliverStartTime time.Time
+	// AckPolicy controls how consumers acknowledge delivery. Defaults to
+	// nats.AckExplicitPolicy.
+	AckPolicy nats.AckPolicy
+	// MaxDeliver caps redelivery attempts for an unacked message.
+	// Defaults to 1 (no redelivery) when <= 0.
+	MaxDeliver int
+	// DurableCalculator names durable consumers. Defaults to
+	// defaultDurableCalculator.
+	DurableCalculator DurableCalculator
+}
+
+// JetStreamOption configures a JetStreamAdapter at construction time.
+type JetStreamOption func(*JetStreamOptions)
+
+func WithDurablePrefix(prefix string) JetStreamOption {
+	return func(o *JetStreamOptions) { o.DurablePrefix = prefix }
+}
+
+func WithDeliverPolicy(p DeliverPolicy) JetStreamOption {
+	return func(o *JetStreamOptions) { o.DeliverPolicy = p }
+}
+
+// WithDeliverStartTime sets DeliverPolicy to DeliverByStartTime and the
+// consumer's start time to t.
+func WithDeliverStartTime(t time.Time) JetStreamOption {
+	return func(o *JetStreamOptions) {
+		o.DeliverPolicy = DeliverByStartTime
+		o.DeliverStartTime = t
+	}
+}
+
+func WithAckPolicy(p nats.AckPolicy) JetStreamOption {
+	return func(o *JetStreamOptions) { o.AckPolicy = p }
+}
+
+func WithMaxDeliver(n int) JetStreamOption {
+	return func(o *JetStreamOptions) { o.MaxDeliver = n }
+}
+
+func WithDurableCalculator(fn DurableCalculator) JetStreamOption {
+	return func(o *JetStreamOptions) { o.DurableCalculator = fn }
+}
+
+// JetStreamAdapter talks to NATS JetStream, auto-creating a stream per
+// subject prefix and supporting durable consumers that survive a
+// subscriber going offline - unlike NewNats's core EncodedConn, which
+// drops messages published while nobody is listening.
+type JetStreamAdapter struct {
+	logger Logger
+	nc     *nats.Conn
+	js     nats.JetStreamContext
+	opts   JetStreamOptions
+}
+
+// NewJetStream connects to url, retrying with the same backoff schedule
+// as NewNats, and returns a JetStreamAdapter ready to publish and
+// subscribe CloudEvents over JetStream.
+func NewJetStream(logger Logger, url string, opts ...JetStreamOption) (*JetStreamAdapter, error) {
+	options := JetStreamOptions{
+		AckPolicy:         nats.AckExplicitPolicy,
+		DurableCalculator: defaultDurableCalculator,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.DurableCalculator == nil {
+		options.DurableCalculator = defaultDurableCalculator
+	}
+
+	dh := nats.DisconnectHandler(func(nc *nats.Conn) {
+		logger.Warn("Connection Disconnected: ", nc.ConnectedUrl())
+	})
+
+	rh := nats.ReconnectHandler(func(nc *nats.Conn) {
+		logger.Warn("Connection Reconnected: ", nc.ConnectedUrl())
+	})
+
+	ch := nats.ClosedHandler(func(nc *nats.Conn) {
+		logger.Warn("Connection Closed: ", nc.LastError())
+	})
+
+	var (
+		err error
+		nc  *nats.Conn
+	)
+
+	for _, interval := range []int{0, 1, 2, 5, 10, 30, 60} {
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		if nc, err = nats.Connect(url, dh, rh, ch); err != nil {
+			continue
+		}
+
+		break
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jetstream context: %w", err)
+	}
+
+	return &JetStreamAdapter{logger: logger, nc: nc, js: js, opts: options}, nil
+}
+
+// streamName derives the auto-created stream name from a subject's first
+// dot-delimited segment, so "order.created" and "order.shipped" share a
+// stream while "audit.login" gets its own.
+func streamName(subject string) string {
+	return strings.ToUpper(strings.SplitN(subject, ".", 2)[0])
+}
+
+func (a *JetStreamAdapter) ensureStream(subject string) error {
+	name := streamName(subject)
+
+	if _, err := a.js.StreamInfo(name); err == nil {
+		return nil
+	}
+
+	// NATS subjects are case-sensitive, so the filter must keep the
+	// subject's original case even though the stream name is upper-cased.
+	prefix := strings.SplitN(subject, ".", 2)[0]
+
+	_, err := a.js.AddStream(&nats.StreamConfig{
+		Name:     name,
+		Subjects: []string{prefix, prefix + ".>"},
+	})
+	return err
+}
+
+func (a *JetStreamAdapter) durableName(queue, subject string) string {
+	name := a.opts.DurableCalculator(queue, subject)
+	if a.opts.DurablePrefix != "" {
+		name = a.opts.DurablePrefix + "-" + name
+	}
+	return name
+}
+
+func (a *JetStreamAdapter) maxDeliver() int {
+	if a.opts.MaxDeliver <= 0 {
+		return 1
+	}
+	return a.opts.MaxDeliver
+}
+
+// Publish encodes event as cloudevents+json and publishes it to subject,
+// auto-creating subject's stream on first use.
+func (a *JetStreamAdapter) Publish(subject string, event cloudevents.Event) error {
+	if err := a.ensureStream(subject); err != nil {
+		return fmt.Errorf("failed to ensure stream for %q: %w", subject, err)
+	}
+
+	data, err := event.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal cloudevent: %w", err)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("Content-Type", ceContentType)
+
+	_, err = a.js.PublishMsg(msg)
+	return err
+}
+
+// Subscribe creates (or resumes) a durable consumer for queue on subject,
+// decoding each message as a CloudEvent and handing it to handler. The
+// durable name comes from DurableCalculator, so restarting the same queue
+// against the same subject resumes rather than replays from DeliverPolicy.
+func (a *JetStreamAdapter) Subscribe(subject, queue string, handler func(cloudevents.Event)) (*nats.Subscription, error) {
+	if err := a.ensureStream(subject); err != nil {
+		return nil, fmt.Errorf("failed to ensure stream for %q: %w", subject, err)
+	}
+
+	subOpts := []nats.SubOpt{
+		nats.Durable(a.durableName(queue, subject)),
+		nats.ManualAck(),
+		nats.MaxDeliver(a.maxDeliver()),
+		nats.DeliverSubject(nats.NewInbox()),
+	}
+
+	switch a.opts.DeliverPolicy {
+	case DeliverLast:
+		subOpts = append(subOpts, nats.DeliverLast())
+	case DeliverNew:
+		subOpts = append(subOpts, nats.DeliverNew())
+	case DeliverByStartTime:
+		subOpts = append(subOpts, nats.StartTime(a.opts.DeliverStartTime))
+	default:
+		subOpts = append(subOpts, nats.DeliverAll())
+	}
+
+	switch a.opts.AckPolicy {
+	case nats.AckNonePolicy:
+		subOpts = append(subOpts, nats.AckNone())
+	case nats.AckAllPolicy:
+		subOpts = append(subOpts, nats.AckAll())
+	default:
+		subOpts = append(subOpts, nats.AckExplicit())
+	}
+
+	return a.js.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		event, err := decodeCloudEvent(msg.Data)
+		if err != nil {
+			a.logger.Warn("failed to decode cloudevent: ", err)
+			return
+		}
+
+		handler(event)
+
+		if err := msg.Ack(); err != nil {
+			a.logger.Warn("failed to ack message: ", err)
+		}
+	}, subOpts...)
+}
+
+// ReplayFrom creates an ephemeral consumer starting at since and delivers
+// every CloudEvent on subject to handler, for backfilling a subscriber
+// rather than relying on a durable consumer's own retained position. The
+// caller owns the returned subscription and must Unsubscribe or Drain it
+// once the replay is no longer needed, or the ephemeral consumer and its
+// delivery goroutine leak.
+func (a *JetStreamAdapter) ReplayFrom(subject string, since time.Time, handler func(cloudevents.Event)) (*nats.Subscription, error) {
+	if err := a.ensureStream(subject); err != nil {
+		return nil, fmt.Errorf("failed to ensure stream for %q: %w", subject, err)
+	}
+
+	return a.js.Subscribe(subject, func(msg *nats.Msg) {
+		event, err := decodeCloudEvent(msg.Data)
+		if err != nil {
+			a.logger.Warn("failed to decode cloudevent: ", err)
+			return
+		}
+
+		handler(event)
+
+		if err := msg.Ack(); err != nil {
+			a.logger.Warn("failed to ack message: ", err)
+		}
+	},
+		nats.DeliverSubject(nats.NewInbox()),
+		nats.StartTime(since),
+		nats.AckExplicit(),
+	)
+}
+
+func decodeCloudEvent(data []byte) (cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	err := event.UnmarshalJSON(data)
+	return event, err
+}
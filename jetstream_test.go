@@ -0,0 +1,72 @@
+package broker
+
+import (
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamName(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{"order.created", "ORDER"},
+		{"order.shipped", "ORDER"},
+		{"audit.login", "AUDIT"},
+		{"noDots", "NODOTS"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, streamName(tt.subject))
+	}
+}
+
+func TestDefaultDurableCalculator(t *testing.T) {
+	name := defaultDurableCalculator("my-queue", "order.created")
+
+	assert.True(t, strings.HasPrefix(name, "my-queue-"))
+
+	suffix := strings.TrimPrefix(name, "my-queue-")
+	assert.Len(t, suffix, 12)
+
+	// Deterministic for the same inputs.
+	assert.Equal(t, name, defaultDurableCalculator("my-queue", "order.created"))
+
+	// Different subjects must not collide.
+	assert.NotEqual(t, name, defaultDurableCalculator("my-queue", "order.shipped"))
+}
+
+func TestJetStreamAdapterDurableName(t *testing.T) {
+	a := &JetStreamAdapter{
+		opts: JetStreamOptions{DurableCalculator: defaultDurableCalculator},
+	}
+
+	base := a.durableName("my-queue", "order.created")
+	assert.Equal(t, defaultDurableCalculator("my-queue", "order.created"), base)
+
+	a.opts.DurablePrefix = "svc"
+	assert.Equal(t, "svc-"+base, a.durableName("my-queue", "order.created"))
+}
+
+func TestDecodeCloudEvent(t *testing.T) {
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetType("order.created")
+	event.SetSource("test")
+	event.SetData(cloudevents.ApplicationJSON, map[string]string{"k": "v"}) //nolint:errcheck
+
+	data, err := event.MarshalJSON()
+	assert.NoError(t, err)
+
+	decoded, err := decodeCloudEvent(data)
+	assert.NoError(t, err)
+	assert.Equal(t, event.ID(), decoded.ID())
+	assert.Equal(t, event.Type(), decoded.Type())
+	assert.Equal(t, event.Source(), decoded.Source())
+
+	_, err = decodeCloudEvent([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,7 @@
+package broker
+
+// Logger is the minimal logging interface required by the NATS and
+// JetStream adapters.
+type Logger interface {
+	Warn(...interface{})
+}
@@ -63,3 +63,41 @@ func (self *adapter) Subscribe(subject string, cb interface{}) (interface{}, err
 func (self *adapter) QueueSubscribe(subject string, queue string, cb interface{}) (interface{}, error) {
 	return self.EncodedConn.QueueSubscribe(subject, queue, cb)
 }
+
+// conn is the subset of *nats.EncodedConn that broker needs, narrowed to
+// interface{} returns so adapter (or a fake) can stand in for it without
+// pulling the concrete nats.go types into this package's public surface.
+type conn interface {
+	Publish(subject string, v interface{}) error
+	Subscribe(subject string, cb interface{}) (interface{}, error)
+	QueueSubscribe(subject string, queue string, cb interface{}) (interface{}, error)
+}
+
+// broker is the legacy gob/json pub/sub client built directly on a NATS
+// EncodedConn - superseded by Broker's in-process CloudEvents delivery,
+// but kept for callers still wired to NewNats's subjects and encoding.
+type broker struct {
+	logger Logger
+	conn   conn
+}
+
+// New wraps conn - typically produced by NewNatsAdapter - in a broker.
+func New(logger Logger, c conn) *broker {
+	return &broker{logger: logger, conn: c}
+}
+
+// Publish publishes v on subject using the EncodedConn's configured encoder.
+func (b *broker) Publish(subject string, v interface{}) error {
+	return b.conn.Publish(subject, v)
+}
+
+// Subscribe forwards every message on subject to cb.
+func (b *broker) Subscribe(subject string, cb interface{}) (interface{}, error) {
+	return b.conn.Subscribe(subject, cb)
+}
+
+// QueueSubscribe forwards messages on subject to cb, load-balanced across
+// every subscriber sharing queue.
+func (b *broker) QueueSubscribe(subject string, queue string, cb interface{}) (interface{}, error) {
+	return b.conn.QueueSubscribe(subject, queue, cb)
+}
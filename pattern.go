@@ -0,0 +1,108 @@
+package broker
+
+import "strings"
+
+// isPattern reports whether eventType contains glob metacharacters and
+// therefore needs to be matched via a compiled pattern rather than the
+// fast-path exact map. The literal "*" is handled separately by the
+// existing allSubscribers path and is not treated as a pattern here.
+func isPattern(eventType string) bool {
+	if eventType == "*" {
+		return false
+	}
+	return strings.ContainsAny(eventType, "*?")
+}
+
+// glob matches dot-delimited CloudEvents types against a pattern where
+// "*" matches exactly one segment, "**" matches zero or more segments,
+// and "?" matches a single character within a segment.
+type glob struct {
+	raw      string
+	segments []string
+}
+
+func compileGlob(pattern string) *glob {
+	return &glob{
+		raw:      pattern,
+		segments: strings.Split(pattern, "."),
+	}
+}
+
+func (g *glob) String() string {
+	return g.raw
+}
+
+func (g *glob) Match(eventType string) bool {
+	return matchSegments(g.segments, strings.Split(eventType, "."))
+}
+
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+
+	head := pattern[0]
+
+	if head == "**" {
+		// "**" may consume zero or more segments.
+		if matchSegments(pattern[1:], segs) {
+			return true
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		return matchSegments(pattern, segs[1:])
+	}
+
+	if len(segs) == 0 {
+		return false
+	}
+
+	if !matchSegment(head, segs[0]) {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segs[1:])
+}
+
+// matchSegment matches a single dot-delimited segment against a pattern
+// using filepath.Match-like semantics: "*" matches any run of characters
+// (including none) and "?" matches exactly one character.
+func matchSegment(pattern, seg string) bool {
+	return matchWildcard(pattern, seg, '*', '?')
+}
+
+// matchWildcard matches s against pattern, where any matches any run of
+// characters (including none) and one matches exactly one character. It
+// backs both the glob matcher above and the SQL-style LIKE operator used
+// by query filters, which use '%'/'_' in place of '*'/'?'.
+func matchWildcard(pattern, s string, any, one rune) bool {
+	pr := []rune(pattern)
+	sr := []rune(s)
+
+	var matchAt func(pi, si int) bool
+	matchAt = func(pi, si int) bool {
+		for pi < len(pr) && pr[pi] != any {
+			if si >= len(sr) {
+				return false
+			}
+			if pr[pi] != one && pr[pi] != sr[si] {
+				return false
+			}
+			pi++
+			si++
+		}
+		if pi == len(pr) {
+			return si == len(sr)
+		}
+		// pr[pi] == any: try consuming 0..n characters.
+		for n := si; n <= len(sr); n++ {
+			if matchAt(pi+1, n) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return matchAt(0, 0)
+}
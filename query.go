@@ -0,0 +1,541 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Query is implemented by anything that can decide whether a CloudEvents
+// event should be delivered to a subscriber registered via SubscribeQuery.
+// The query subpackage ships trivial All and Empty implementations.
+type Query interface {
+	Matches(event cloudevents.Event) bool
+}
+
+// ParseQuery parses a Tendermint-pubsub-flavored boolean expression over
+// CloudEvents context attributes (type, source, id, subject, time,
+// datacontenttype, dataschema, specversion), extensions, and dotted JSON
+// data paths (data.x.y), e.g.:
+//
+//	type = 'order.created' AND source LIKE 'svc.%' AND data.amount > 100
+//
+// Supported operators are =, !=, <, <=, >, >=, LIKE, CONTAINS, IN (...),
+// combined with AND, OR, NOT and parentheses. String literals are single
+// quoted; numbers are bare.
+func ParseQuery(s string) (Query, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("broker: unexpected token %q in query", p.tokens[p.pos].text)
+	}
+
+	return expr, nil
+}
+
+// --- tokenizer ---
+
+type queryTokenKind int
+
+const (
+	tokIdent queryTokenKind = iota
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+func tokenizeQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	runes := []rune(s)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+
+		case r == '(':
+			tokens = append(tokens, queryToken{tokLParen, "("})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, queryToken{tokRParen, ")"})
+			i++
+
+		case r == ',':
+			tokens = append(tokens, queryToken{tokComma, ","})
+			i++
+
+		case r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != '\'' {
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("broker: unterminated string literal in query")
+			}
+			tokens = append(tokens, queryToken{tokString, string(runes[i+1 : j])})
+			i = j + 1
+
+		case r == '!' || r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, queryToken{tokOp, string(runes[i : i+2])})
+				i += 2
+			} else {
+				tokens = append(tokens, queryToken{tokOp, string(r)})
+				i++
+			}
+
+		case r == '=':
+			tokens = append(tokens, queryToken{tokOp, "="})
+			i++
+
+		case isDigit(r) || (r == '-' && i+1 < len(runes) && isDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (isDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, queryToken{tokNumber, string(runes[i:j])})
+			i = j
+
+		case isIdentRune(r):
+			j := i + 1
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, queryToken{tokIdent, string(runes[i:j])})
+			i = j
+
+		default:
+			return nil, fmt.Errorf("broker: unexpected character %q in query", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isIdentRune(r rune) bool {
+	return r == '.' || r == '_' || r == '-' ||
+		(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || isDigit(r)
+}
+
+// --- parser (recursive descent: OR > AND > NOT > comparison) ---
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) keyword(kw string) bool {
+	tok, ok := p.peek()
+	return ok && tok.kind == tokIdent && strings.EqualFold(tok.text, kw)
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orQuery{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("AND") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andQuery{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (Query, error) {
+	if p.keyword("NOT") {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notQuery{operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (Query, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("broker: unexpected end of query")
+	}
+
+	if tok.kind == tokLParen {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.kind != tokRParen {
+			return nil, fmt.Errorf("broker: expected ')' in query")
+		}
+		p.pos++
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (Query, error) {
+	ident, ok := p.peek()
+	if !ok || ident.kind != tokIdent {
+		return nil, fmt.Errorf("broker: expected identifier in query")
+	}
+	p.pos++
+
+	op, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("broker: expected operator after %q in query", ident.text)
+	}
+
+	if op.kind == tokIdent && strings.EqualFold(op.text, "IN") {
+		p.pos++
+		if lparen, ok := p.peek(); !ok || lparen.kind != tokLParen {
+			return nil, fmt.Errorf("broker: expected '(' after IN in query")
+		}
+		p.pos++
+
+		var values []interface{}
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+
+			next, ok := p.peek()
+			if !ok {
+				return nil, fmt.Errorf("broker: unterminated IN (...) in query")
+			}
+			if next.kind == tokComma {
+				p.pos++
+				continue
+			}
+			if next.kind == tokRParen {
+				p.pos++
+				break
+			}
+			return nil, fmt.Errorf("broker: expected ',' or ')' in IN (...) in query")
+		}
+
+		return inQuery{path: ident.text, values: values}, nil
+	}
+
+	var opName string
+	switch {
+	case op.kind == tokOp:
+		opName = op.text
+	case op.kind == tokIdent && (strings.EqualFold(op.text, "LIKE") || strings.EqualFold(op.text, "CONTAINS")):
+		opName = strings.ToUpper(op.text)
+	default:
+		return nil, fmt.Errorf("broker: expected operator after %q in query, got %q", ident.text, op.text)
+	}
+	p.pos++
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return comparisonQuery{path: ident.text, op: opName, value: value}, nil
+}
+
+func (p *queryParser) parseValue() (interface{}, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("broker: expected value in query")
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokString:
+		return tok.text, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("broker: invalid number %q in query", tok.text)
+		}
+		return f, nil
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return tok.text, nil
+	default:
+		return nil, fmt.Errorf("broker: expected value in query, got %q", tok.text)
+	}
+}
+
+// --- AST ---
+
+type andQuery struct{ left, right Query }
+
+func (q andQuery) Matches(event cloudevents.Event) bool {
+	return q.left.Matches(event) && q.right.Matches(event)
+}
+
+type orQuery struct{ left, right Query }
+
+func (q orQuery) Matches(event cloudevents.Event) bool {
+	return q.left.Matches(event) || q.right.Matches(event)
+}
+
+type notQuery struct{ operand Query }
+
+func (q notQuery) Matches(event cloudevents.Event) bool {
+	return !q.operand.Matches(event)
+}
+
+type comparisonQuery struct {
+	path  string
+	op    string
+	value interface{}
+}
+
+func (q comparisonQuery) Matches(event cloudevents.Event) bool {
+	actual, ok := lookupAttr(event, q.path)
+	if !ok {
+		return false
+	}
+	return evalOp(q.op, actual, q.value)
+}
+
+type inQuery struct {
+	path   string
+	values []interface{}
+}
+
+func (q inQuery) Matches(event cloudevents.Event) bool {
+	actual, ok := lookupAttr(event, q.path)
+	if !ok {
+		return false
+	}
+	for _, v := range q.values {
+		if evalOp("=", actual, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- attribute lookup ---
+
+// lookupAttr resolves a dotted identifier against an event's standard
+// CloudEvents context attributes, its extensions, or - under the "data."
+// prefix - its JSON-decoded data.
+func lookupAttr(event cloudevents.Event, path string) (interface{}, bool) {
+	if path == "data" || strings.HasPrefix(path, "data.") {
+		return lookupData(event, strings.TrimPrefix(path, "data"))
+	}
+
+	switch path {
+	case "type":
+		return event.Type(), true
+	case "source":
+		return event.Source(), true
+	case "id":
+		return event.ID(), true
+	case "subject":
+		return event.Subject(), true
+	case "time":
+		return event.Time(), true
+	case "datacontenttype":
+		return event.DataContentType(), true
+	case "dataschema":
+		return event.DataSchema(), true
+	case "specversion":
+		return event.SpecVersion(), true
+	}
+
+	if v, ok := event.Extensions()[path]; ok {
+		return v, true
+	}
+
+	return nil, false
+}
+
+func lookupData(event cloudevents.Event, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(path, ".")
+
+	var data interface{}
+	if err := json.Unmarshal(event.Data(), &data); err != nil {
+		return nil, false
+	}
+
+	if path == "" {
+		return data, true
+	}
+
+	for _, seg := range strings.Split(path, ".") {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data, ok = m[seg]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+// --- operator evaluation ---
+
+func evalOp(op string, actual, want interface{}) bool {
+	switch op {
+	case "=":
+		return valuesEqual(actual, want)
+	case "!=":
+		return !valuesEqual(actual, want)
+	case "<", "<=", ">", ">=":
+		af, aok := toFloat(actual)
+		wf, wok := toFloat(want)
+		if !aok || !wok {
+			return false
+		}
+		switch op {
+		case "<":
+			return af < wf
+		case "<=":
+			return af <= wf
+		case ">":
+			return af > wf
+		default:
+			return af >= wf
+		}
+	case "LIKE":
+		as, aok := toString(actual)
+		ws, wok := want.(string)
+		if !aok || !wok {
+			return false
+		}
+		return matchWildcard(ws, as, '%', '_')
+	case "CONTAINS":
+		return contains(actual, want)
+	default:
+		return false
+	}
+}
+
+func valuesEqual(actual, want interface{}) bool {
+	if af, aok := toFloat(actual); aok {
+		if wf, wok := toFloat(want); wok {
+			return af == wf
+		}
+	}
+
+	as, aok := toString(actual)
+	ws, wok := toString(want)
+	return aok && wok && as == ws
+}
+
+func contains(actual, want interface{}) bool {
+	switch v := actual.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if valuesEqual(item, want) {
+				return true
+			}
+		}
+		return false
+	default:
+		as, aok := toString(actual)
+		ws, wok := toString(want)
+		return aok && wok && strings.Contains(as, ws)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case time.Time:
+		return s.Format(time.RFC3339), true
+	case fmt.Stringer:
+		return s.String(), true
+	case bool:
+		return strconv.FormatBool(s), true
+	default:
+		return "", false
+	}
+}
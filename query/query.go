@@ -0,0 +1,15 @@
+// Package query provides trivial broker.Query implementations for the
+// common cases that don't need ParseQuery's expression language.
+package query
+
+import cloudevents "github.com/cloudevents/sdk-go/v2"
+
+// All matches every event, equivalent to subscribing to "*".
+type All struct{}
+
+func (All) Matches(cloudevents.Event) bool { return true }
+
+// Empty matches no event.
+type Empty struct{}
+
+func (Empty) Matches(cloudevents.Event) bool { return false }
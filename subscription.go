@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// ErrSlowConsumer is reported on a Subscription's Err channel when the
+// broker cancels it under the Cancel overflow policy, or under Block when
+// the subscription's Context is done, or the broker shuts down, before
+// room becomes available.
+var ErrSlowConsumer = errors.New("broker: slow consumer canceled")
+
+// OverflowPolicy controls what Publish does when a subscriber's buffered
+// Events channel is full.
+type OverflowPolicy int
+
+const (
+	// Block makes Publish wait for the subscriber to make room, or for
+	// the subscription's Context to be done if one was supplied, or for
+	// the broker to Shutdown, whichever comes first. This is the
+	// default. Unlike the broker's historical behavior - which spawned a
+	// goroutine per delivery so Publish itself never blocked - Publish is
+	// now synchronous, so a slow subscriber with no Context stalls every
+	// caller of Publish until it reads or the broker shuts down.
+	Block OverflowPolicy = iota
+	// DropOldest discards the oldest buffered event to make room for the
+	// new one.
+	DropOldest
+	// DropNewest discards the incoming event, leaving the buffer as is.
+	DropNewest
+	// Cancel unsubscribes the subscriber and reports ErrSlowConsumer.
+	Cancel
+)
+
+// SubscribeOptions configures a subscription created via
+// Broker.SubscribeWithOptions.
+type SubscribeOptions struct {
+	// Capacity is the size of the buffered Events channel. Defaults to 10
+	// when <= 0.
+	Capacity int
+
+	// OverflowPolicy controls what happens once the buffer is full.
+	OverflowPolicy OverflowPolicy
+
+	// Context, when set, is raced against a blocked send under the Block
+	// policy - when it's done the subscription is canceled instead of
+	// blocking Publish forever.
+	Context context.Context
+}
+
+// Subscription is returned by SubscribeWithOptions and SubscribeQuery.
+type Subscription interface {
+	// Events delivers matching events until the subscription is
+	// unsubscribed or canceled, at which point the channel is closed.
+	Events() <-chan cloudevents.Event
+	// Err receives at most one value - currently only ErrSlowConsumer -
+	// when the broker cancels this subscription on its own.
+	Err() <-chan error
+	// Unsubscribe stops delivery and closes Events. Safe to call more
+	// than once.
+	Unsubscribe()
+}
+
+// subscriber is the internal representation shared by every subscriber
+// list the broker keeps (exact, wildcard, pattern and query).
+type subscriber struct {
+	events chan cloudevents.Event
+	errs   chan error
+	opts   SubscribeOptions
+
+	// unregister removes this subscriber from whichever list it was
+	// registered in. Set by the broker at registration time.
+	unregister func()
+
+	// stateMu serializes close against any in-flight send: every send
+	// attempt holds a read lock for the duration of the attempt and
+	// bails out if closed is already set, while close takes the write
+	// lock, so a send can never race a close on events.
+	stateMu sync.RWMutex
+	closed  bool
+
+	closeOnce sync.Once
+}
+
+func newSubscriber(opts SubscribeOptions) *subscriber {
+	if opts.Capacity <= 0 {
+		opts.Capacity = 10
+	}
+
+	return &subscriber{
+		events: make(chan cloudevents.Event, opts.Capacity),
+		errs:   make(chan error, 1),
+		opts:   opts,
+	}
+}
+
+func (s *subscriber) Events() <-chan cloudevents.Event { return s.events }
+
+func (s *subscriber) Err() <-chan error { return s.errs }
+
+func (s *subscriber) Unsubscribe() {
+	if s.unregister != nil {
+		s.unregister()
+	}
+	s.close(nil)
+}
+
+// close closes Events exactly once, optionally reporting err on Err first.
+// It takes stateMu's write lock, so it waits for any in-flight send (which
+// holds the read lock) to finish before closing events out from under it.
+func (s *subscriber) close(err error) {
+	s.closeOnce.Do(func() {
+		s.stateMu.Lock()
+		s.closed = true
+		s.stateMu.Unlock()
+
+		if err != nil {
+			s.errs <- err
+		}
+		close(s.events)
+	})
+}
+
+// trySend attempts a single non-blocking send, reporting whether it
+// succeeded and whether the subscriber was already closed.
+func (s *subscriber) trySend(event cloudevents.Event) (sent, closed bool) {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+
+	if s.closed {
+		return false, true
+	}
+
+	select {
+	case s.events <- event:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// dropOldestOrDiscard evicts the oldest buffered event and retries the
+// send once, giving up (dropping event) rather than blocking if a
+// concurrent delivery refills the buffer first. Reports whether the
+// subscriber was already closed.
+func (s *subscriber) dropOldestOrDiscard(event cloudevents.Event) (closed bool) {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+
+	if s.closed {
+		return true
+	}
+
+	select {
+	case <-s.events:
+	default:
+	}
+	select {
+	case s.events <- event:
+	default:
+	}
+
+	return false
+}
+
+// blockingSend sends event, waiting for room, ctxDone or shutdownCh -
+// whichever comes first. It reports whether the subscriber was already
+// closed, and whether it should now be canceled because ctxDone or
+// shutdownCh fired before the send could complete.
+func (s *subscriber) blockingSend(event cloudevents.Event, ctxDone, shutdownCh <-chan struct{}) (closed, cancel bool) {
+	s.stateMu.RLock()
+
+	if s.closed {
+		s.stateMu.RUnlock()
+		return true, false
+	}
+
+	select {
+	case s.events <- event:
+	case <-ctxDone:
+		cancel = true
+	case <-shutdownCh:
+		cancel = true
+	}
+
+	s.stateMu.RUnlock()
+
+	return false, cancel
+}